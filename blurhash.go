@@ -0,0 +1,198 @@
+package thumbnailer
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// blurHashCharacters is the base83 alphabet used by the BlurHash format.
+const blurHashCharacters = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+const (
+	defaultXComponents = 4
+	defaultYComponents = 3
+)
+
+// blurHashComponents resolves the XComponents/YComponents to use for a
+// BlurHash encode, falling back to the package defaults when unset.
+func blurHashComponents(opts Options) (x, y int) {
+	x, y = opts.XComponents, opts.YComponents
+	if x <= 0 {
+		x = defaultXComponents
+	}
+	if y <= 0 {
+		y = defaultYComponents
+	}
+	return x, y
+}
+
+// encodeBlurHash computes a BlurHash preview string for img using
+// xComponents*yComponents DCT basis functions, per the public BlurHash
+// algorithm (https://github.com/woltapp/blurhash).
+func encodeBlurHash(img image.Image, xComponents, yComponents int) string {
+	if xComponents < 1 {
+		xComponents = 1
+	} else if xComponents > 9 {
+		xComponents = 9
+	}
+	if yComponents < 1 {
+		yComponents = 1
+	} else if yComponents > 9 {
+		yComponents = 9
+	}
+
+	src := toRGBAForHash(img)
+	if src.Bounds().Dx() == 0 || src.Bounds().Dy() == 0 {
+		return ""
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			factors = append(factors, blurHashBasis(src, i, j))
+		}
+	}
+	dc, ac := factors[0], factors[1:]
+
+	var maxAC float64
+	for _, f := range ac {
+		for _, c := range f {
+			if a := math.Abs(c); a > maxAC {
+				maxAC = a
+			}
+		}
+	}
+
+	sizeFlag := (xComponents - 1) + (yComponents-1)*9
+
+	quantizedMaxAC := 0
+	actualMaxAC := 1.0
+	if len(ac) > 0 {
+		quantizedMaxAC = clampInt(int(math.Floor(maxAC*166-0.5)), 0, 82)
+		actualMaxAC = (float64(quantizedMaxAC) + 1) / 166
+	}
+
+	hash := base83Encode(sizeFlag, 1) +
+		base83Encode(quantizedMaxAC, 1) +
+		base83Encode(encodeDC(dc), 4)
+	for _, f := range ac {
+		hash += base83Encode(encodeAC(f, actualMaxAC), 2)
+	}
+	return hash
+}
+
+// blurHashBasis computes the (i, j) DCT basis coefficient c_ij over src:
+// c_ij = scale * sum_x sum_y cos(pi*i*x/W)*cos(pi*j*y/H) * linear(pixel[x,y])
+// where scale is 1/(W*H) for the DC term (i=j=0) and 2/(W*H) otherwise.
+func blurHashBasis(src *image.RGBA, i, j int) [3]float64 {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	normalization := 1.0
+	if i > 0 || j > 0 {
+		normalization = 2.0
+	}
+
+	var r, g, bl float64
+	for y := 0; y < h; y++ {
+		rowOff := y * src.Stride
+		cosY := math.Cos(math.Pi * float64(j) * float64(y) / float64(h))
+		for x := 0; x < w; x++ {
+			basis := cosY * math.Cos(math.Pi*float64(i)*float64(x)/float64(w))
+			off := rowOff + x*4
+			r += basis * sRGBToLinear(src.Pix[off])
+			g += basis * sRGBToLinear(src.Pix[off+1])
+			bl += basis * sRGBToLinear(src.Pix[off+2])
+		}
+	}
+
+	scale := normalization / float64(w*h)
+	return [3]float64{r * scale, g * scale, bl * scale}
+}
+
+// sRGBToLinear converts an 8-bit sRGB channel value to linear light.
+func sRGBToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB converts a linear light value back to an 8-bit sRGB channel.
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return clampInt(int(math.Round(v*12.92*255)), 0, 255)
+	}
+	return clampInt(int(math.Round((1.055*math.Pow(v, 1/2.4)-0.055)*255)), 0, 255)
+}
+
+// encodeDC packs the DC component as 24 bits of sRGB: 8 bits per channel.
+func encodeDC(c [3]float64) int {
+	r := linearToSRGB(c[0])
+	g := linearToSRGB(c[1])
+	b := linearToSRGB(c[2])
+	return (r << 16) + (g << 8) + b
+}
+
+// encodeAC quantizes an AC component against maxVal into base-19 digits per
+// channel, matching the reference BlurHash quantization.
+func encodeAC(c [3]float64, maxVal float64) int {
+	quantR := clampInt(int(math.Floor(signedPow(c[0]/maxVal, 0.5)*9+9.5)), 0, 18)
+	quantG := clampInt(int(math.Floor(signedPow(c[1]/maxVal, 0.5)*9+9.5)), 0, 18)
+	quantB := clampInt(int(math.Floor(signedPow(c[2]/maxVal, 0.5)*9+9.5)), 0, 18)
+	return quantR*19*19 + quantG*19 + quantB
+}
+
+// signedPow raises |v| to exp, preserving the sign of v.
+func signedPow(v, exp float64) float64 {
+	if v < 0 {
+		return -math.Pow(-v, exp)
+	}
+	return math.Pow(v, exp)
+}
+
+// base83Encode encodes value as a fixed-width base83 string of the given
+// length, the digit packing BlurHash uses for its header and components.
+func base83Encode(value, length int) string {
+	buf := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / pow83(length-i)) % 83
+		buf[i-1] = blurHashCharacters[digit]
+	}
+	return string(buf)
+}
+
+func pow83(n int) int {
+	result := 1
+	for i := 0; i < n; i++ {
+		result *= 83
+	}
+	return result
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
+
+// toRGBAForHash converts img to *image.RGBA for BlurHash sampling. It does
+// not use bufferPool since this runs at most once per Process call on an
+// already small image (the IDCT-downscaled decode on the JPEG path, the
+// scaled intermediate on the native path).
+func toRGBAForHash(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
@@ -0,0 +1,262 @@
+package thumbnailer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache is the storage backend for CachedProcessor.
+type Cache interface {
+	// Get returns a reader for the cached thumbnail stored under key, and
+	// false if nothing is cached for that key. The caller must Close the
+	// returned reader.
+	Get(key string) (io.ReadCloser, bool)
+	// Put stores r's contents under key, replacing any existing entry.
+	Put(key string, r io.Reader) error
+}
+
+// CachedProcessor wraps Process with a Cache keyed on the SHA-256 of the
+// input stream combined with a canonical encoding of Options, so that
+// repeated requests for the same blob at the same size are served from
+// cache instead of being re-decoded and re-encoded.
+type CachedProcessor struct {
+	Cache Cache
+}
+
+// NewCachedProcessor returns a CachedProcessor backed by cache.
+func NewCachedProcessor(cache Cache) *CachedProcessor {
+	return &CachedProcessor{Cache: cache}
+}
+
+// Process serves out from cache when this exact input and Options have been
+// seen before, and populates the cache on a miss. Unlike the package-level
+// Process, it accepts a plain io.Reader: the input is teed into a buffer
+// while it is hashed, so non-seekable streams (e.g. an HTTP request body)
+// work without the caller buffering them first.
+//
+// The Result returned alongside the cached bytes (e.g. BlurHash) is packed
+// into the same cache entry via encodeCacheEnvelope, so a cache hit returns
+// the same Result a miss would have computed instead of a zero value.
+func (p *CachedProcessor) Process(in io.Reader, out io.Writer, opts Options) (Result, error) {
+	var buf bytes.Buffer
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, io.TeeReader(in, &buf)); err != nil {
+		return Result{}, err
+	}
+	optsJSON, _ := json.Marshal(opts) // Options holds only basic value types; this cannot fail.
+	hasher.Write(optsJSON)
+	key := hex.EncodeToString(hasher.Sum(nil))
+
+	if r, ok := p.Cache.Get(key); ok {
+		defer r.Close()
+		blob, err := io.ReadAll(r)
+		if err != nil {
+			return Result{}, err
+		}
+		result, payload, err := decodeCacheEnvelope(blob)
+		if err != nil {
+			return Result{}, err
+		}
+		_, err = out.Write(payload)
+		return result, err
+	}
+
+	var encoded bytes.Buffer
+	result, err := Process(bytes.NewReader(buf.Bytes()), &encoded, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := p.Cache.Put(key, bytes.NewReader(encodeCacheEnvelope(result, encoded.Bytes()))); err != nil {
+		return Result{}, err
+	}
+	if _, err := out.Write(encoded.Bytes()); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// encodeCacheEnvelope packs result and the encoded thumbnail bytes into a
+// single blob for storage behind Cache, which only stores raw bytes: a
+// 4-byte big-endian length prefix, the JSON-encoded Result, then the
+// thumbnail bytes. Without this, a cache hit would have no way to recover
+// the Result a miss computed (e.g. BlurHash), and would report a zero Result
+// instead.
+func encodeCacheEnvelope(result Result, encoded []byte) []byte {
+	meta, _ := json.Marshal(result) // Result holds only basic value types; this cannot fail.
+	envelope := make([]byte, 4+len(meta)+len(encoded))
+	binary.BigEndian.PutUint32(envelope, uint32(len(meta)))
+	copy(envelope[4:], meta)
+	copy(envelope[4+len(meta):], encoded)
+	return envelope
+}
+
+// decodeCacheEnvelope reverses encodeCacheEnvelope.
+func decodeCacheEnvelope(blob []byte) (Result, []byte, error) {
+	if len(blob) < 4 {
+		return Result{}, nil, errors.New("thumbnailer: corrupt cache entry")
+	}
+	n := binary.BigEndian.Uint32(blob)
+	if uint32(len(blob)-4) < n {
+		return Result{}, nil, errors.New("thumbnailer: corrupt cache entry")
+	}
+	var result Result
+	if err := json.Unmarshal(blob[4:4+n], &result); err != nil {
+		return Result{}, nil, err
+	}
+	return result, blob[4+n:], nil
+}
+
+// FSCache is a Cache implementation that stores thumbnails on disk under
+// <root>/<xx>/<yy>/<key>.jpg, two-level sharded by the first four hex
+// characters of the key so no single directory accumulates too many
+// entries. When MaxBytes is positive, a background goroutine trims the
+// least-recently-used entries after every write that pushes the store over
+// the limit.
+type FSCache struct {
+	Root     string
+	MaxBytes int64
+
+	mu      sync.Mutex
+	evictCh chan struct{}
+	stopCh  chan struct{}
+}
+
+// NewFSCache creates an FSCache rooted at root. If maxBytes is positive, a
+// background eviction goroutine is started; call Close to stop it.
+func NewFSCache(root string, maxBytes int64) *FSCache {
+	c := &FSCache{
+		Root:     root,
+		MaxBytes: maxBytes,
+		evictCh:  make(chan struct{}, 1),
+		stopCh:   make(chan struct{}),
+	}
+	if maxBytes > 0 {
+		go c.evictLoop()
+	}
+	return c
+}
+
+// Close stops the background eviction goroutine. It is a no-op if MaxBytes
+// was not positive.
+func (c *FSCache) Close() {
+	select {
+	case <-c.stopCh:
+	default:
+		close(c.stopCh)
+	}
+}
+
+func (c *FSCache) pathFor(key string) string {
+	if len(key) < 4 {
+		return filepath.Join(c.Root, key+".jpg")
+	}
+	return filepath.Join(c.Root, key[:2], key[2:4], key+".jpg")
+}
+
+// Get implements Cache.
+func (c *FSCache) Get(key string) (io.ReadCloser, bool) {
+	f, err := os.Open(c.pathFor(key))
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(f.Name(), now, now) // bump mtime so LRU eviction treats this as recently used
+	return f, true
+}
+
+// Put implements Cache.
+func (c *FSCache) Put(key string, r io.Reader) error {
+	path := c.pathFor(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	select {
+	case c.evictCh <- struct{}{}:
+	default:
+		// An eviction pass is already pending; it will see this entry too.
+	}
+	return nil
+}
+
+type fsCacheEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (c *FSCache) evictLoop() {
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-c.evictCh:
+			c.evictOnce()
+		}
+	}
+}
+
+// evictOnce walks the cache root and removes the oldest (by mtime) entries
+// until the total size is back under MaxBytes.
+func (c *FSCache) evictOnce() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var entries []fsCacheEntry
+	var total int64
+	filepath.WalkDir(c.Root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries = append(entries, fsCacheEntry{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+
+	if total <= c.MaxBytes {
+		return
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+
+	for _, e := range entries {
+		if total <= c.MaxBytes {
+			break
+		}
+		if err := os.Remove(e.path); err == nil {
+			total -= e.size
+		}
+	}
+}
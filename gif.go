@@ -0,0 +1,191 @@
+package thumbnailer
+
+import (
+	"encoding/json"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"io"
+)
+
+// OutputFormat selects the encoding used by the native (non-JPEG-input)
+// thumbnail path.
+type OutputFormat int
+
+const (
+	// FormatJPEG is the zero value and original behavior.
+	FormatJPEG OutputFormat = iota
+	// FormatPNG preserves transparency instead of flattening onto black.
+	FormatPNG
+	// FormatGIF re-encodes every frame of an animated input as a downscaled
+	// animated GIF, or a single-frame GIF for a static input.
+	FormatGIF
+)
+
+// frameSelectMode is the kind of frame selection requested via Options.Frame.
+type frameSelectMode int
+
+const (
+	frameFirst frameSelectMode = iota
+	frameMiddle
+	frameSpecific
+)
+
+// FrameSelector picks a representative frame from an animated input. Use the
+// FrameFirst/FrameMiddle values directly, or FrameSpecific(n) for an exact
+// index.
+type FrameSelector struct {
+	mode  frameSelectMode
+	index int
+}
+
+var (
+	// FrameFirst selects the first frame. It is the zero value of FrameSelector.
+	FrameFirst = FrameSelector{mode: frameFirst}
+	// FrameMiddle selects the middle frame (rounding down).
+	FrameMiddle = FrameSelector{mode: frameMiddle}
+)
+
+// FrameSpecific selects frame index n, clamped to the animation's frame count.
+func FrameSpecific(n int) FrameSelector {
+	return FrameSelector{mode: frameSpecific, index: n}
+}
+
+// MarshalJSON implements json.Marshaler. FrameSelector's fields are
+// unexported, so without this, json.Marshal(FrameSelector{}) always produces
+// "{}" regardless of mode or index — notably breaking CachedProcessor, which
+// hashes a json.Marshal of Options to build its cache key.
+func (f FrameSelector) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Mode  frameSelectMode `json:"mode"`
+		Index int             `json:"index"`
+	}{f.mode, f.index})
+}
+
+// resolve returns the frame index to use out of n total frames.
+func (f FrameSelector) resolve(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	switch f.mode {
+	case frameMiddle:
+		return (n - 1) / 2
+	case frameSpecific:
+		switch {
+		case f.index < 0:
+			return 0
+		case f.index >= n:
+			return n - 1
+		default:
+			return f.index
+		}
+	default:
+		return 0
+	}
+}
+
+// isGIFHeader reports whether the sniffed header bytes look like a GIF.
+func isGIFHeader(header []byte) bool {
+	return len(header) >= 6 && header[0] == 'G' && header[1] == 'I' && header[2] == 'F' && header[3] == '8'
+}
+
+// createGIFThumbnail handles an animated or static GIF input: it either
+// re-encodes the whole animation (OutputFormat == FormatGIF) or picks a
+// single representative frame per opts.Frame and runs it through the normal
+// static-image pipeline.
+func createGIFThumbnail(in io.Reader, out io.Writer, opts Options) (Result, error) {
+	g, err := gif.DecodeAll(in)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if opts.OutputFormat == FormatGIF {
+		return encodeAnimatedGIF(g, out, opts)
+	}
+
+	frame := opts.Frame.resolve(len(g.Image))
+	composited := newGIFCompositor(g).Frame(frame)
+	return encodeNativeFromImage(composited, out, opts)
+}
+
+// gifCompositor replays GIF disposal semantics across consecutive calls to
+// Frame, building up the canvas the way a GIF player would. Frame must be
+// called with non-decreasing indices.
+type gifCompositor struct {
+	g        *gif.GIF
+	canvas   *image.NRGBA
+	previous *image.NRGBA
+	next     int
+}
+
+func newGIFCompositor(g *gif.GIF) *gifCompositor {
+	return &gifCompositor{
+		g:      g,
+		canvas: image.NewNRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height)),
+	}
+}
+
+// Frame advances the compositor through frame i and returns the resulting canvas.
+func (c *gifCompositor) Frame(i int) *image.NRGBA {
+	for ; c.next <= i && c.next < len(c.g.Image); c.next++ {
+		if c.next > 0 {
+			switch c.g.Disposal[c.next-1] {
+			case gif.DisposalBackground:
+				draw.Draw(c.canvas, c.g.Image[c.next-1].Bounds(), image.Transparent, image.Point{}, draw.Src)
+			case gif.DisposalPrevious:
+				if c.previous != nil {
+					draw.Draw(c.canvas, c.canvas.Bounds(), c.previous, image.Point{}, draw.Src)
+				}
+			}
+		}
+		if c.g.Disposal[c.next] == gif.DisposalPrevious {
+			snap := image.NewNRGBA(c.canvas.Bounds())
+			draw.Draw(snap, snap.Bounds(), c.canvas, image.Point{}, draw.Src)
+			c.previous = snap
+		}
+		frame := c.g.Image[c.next]
+		draw.Draw(c.canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	}
+	return c.canvas
+}
+
+// encodeAnimatedGIF resizes every frame of src through the normal resize
+// pipeline (reusing the compositor so each frame is only assembled once) and
+// re-encodes the result as an animated GIF, preserving delay, disposal, and
+// loop metadata. When opts.EmitBlurHash is set, the BlurHash is computed from
+// the first resized frame.
+func encodeAnimatedGIF(src *gif.GIF, out io.Writer, opts Options) (Result, error) {
+	anim := &gif.GIF{LoopCount: src.LoopCount}
+	compositor := newGIFCompositor(src)
+	var result Result
+
+	for i := range src.Image {
+		frame := compositor.Frame(i)
+		resized := resize(frame, opts)
+		if i == 0 && opts.EmitBlurHash {
+			xComp, yComp := blurHashComponents(opts)
+			result.BlurHash = encodeBlurHash(resized, xComp, yComp)
+		}
+
+		bounds := resized.Bounds()
+		paletted := image.NewPaletted(bounds, palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, bounds, resized, bounds.Min)
+
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, src.Delay[i])
+		anim.Disposal = append(anim.Disposal, src.Disposal[i])
+	}
+
+	if err := gif.EncodeAll(out, anim); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// gifEncode writes img as a single-frame GIF, used for OutputFormat ==
+// FormatGIF on a static (non-animated) source image, and by ProcessMulti,
+// which decodes only the first frame of an animated GIF.
+func gifEncode(out io.Writer, img image.Image) error {
+	return gif.Encode(out, img, nil)
+}
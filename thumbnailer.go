@@ -4,12 +4,14 @@
 package thumbnailer
 
 import (
-	_ "errors"
+	"bytes"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	"image/jpeg"
-	_ "image/png" // Register PNG decoder
+	"image/png"
 	"io"
 	"math"
 	"os"
@@ -21,11 +23,156 @@ import (
 	libjpeg "github.com/pixiv/go-libjpeg/jpeg"
 )
 
+// ErrInputTooLarge is returned by Process when an input exceeds the
+// configured MaxInputBytes, MaxInputPixels, or MaxInputDimension.
+var ErrInputTooLarge = errors.New("thumbnailer: input exceeds configured size limits")
+
+// ResizeMode controls how the source image is fitted into the requested
+// MaxWidth x MaxHeight box.
+type ResizeMode int
+
+const (
+	// ModeScale fits the image inside MaxWidth/MaxHeight while preserving
+	// aspect ratio. The output may be smaller than the box in one dimension.
+	// This is the zero value and matches the library's original behavior.
+	ModeScale ResizeMode = iota
+	// ModeFit is an explicit alias for ModeScale, for callers that want to
+	// name their intent rather than rely on the default.
+	ModeFit
+	// ModeCrop scales the image to fill MaxWidth/MaxHeight and center-crops
+	// the excess, producing an exact MaxWidth x MaxHeight output.
+	ModeCrop
+	// ModePad scales the image to fit inside MaxWidth/MaxHeight and pads the
+	// remaining space with PadColor, producing an exact MaxWidth x MaxHeight
+	// output.
+	ModePad
+)
+
 // Options defines the parameters for thumbnail generation.
 type Options struct {
 	MaxWidth  int
 	MaxHeight int
 	Quality   int // JPEG quality (1-100)
+
+	// ResizeMode selects how the source is fitted into MaxWidth/MaxHeight.
+	// The zero value, ModeScale, preserves the original behavior.
+	ResizeMode ResizeMode
+	// PadColor is the background color used to fill the margins added by
+	// ModePad. It is ignored for all other modes. The zero value is
+	// transparent black: black in JPEG output, transparent in PNG output.
+	PadColor color.RGBA
+
+	// Interpolation selects the resampling kernel used for the final resize.
+	// The zero value, InterpBox, preserves the original behavior.
+	Interpolation Interpolation
+
+	// EmitBlurHash requests that a BlurHash preview string be computed from
+	// the decoded image and returned in Result.BlurHash.
+	EmitBlurHash bool
+	// XComponents and YComponents set the number of BlurHash DCT components
+	// in each dimension. They are only used when EmitBlurHash is true; zero
+	// values default to 4 and 3 respectively.
+	XComponents int
+	YComponents int
+
+	// MaxInputBytes, if positive, rejects inputs larger than this many bytes
+	// with ErrInputTooLarge, even if the stream is cut off mid-decode.
+	MaxInputBytes int64
+	// MaxInputPixels, if positive, rejects inputs whose width*height exceeds
+	// this value with ErrInputTooLarge before any pixel buffers are allocated.
+	MaxInputPixels int64
+	// MaxInputDimension, if positive, rejects inputs whose width or height
+	// exceeds this value with ErrInputTooLarge before any pixel buffers are
+	// allocated.
+	MaxInputDimension int
+
+	// Frame selects which frame of an animated input (currently GIF) is used
+	// to produce a static thumbnail. It is ignored for OutputFormat ==
+	// FormatGIF, which thumbnails every frame instead. The zero value is
+	// FrameFirst.
+	Frame FrameSelector
+	// OutputFormat selects the encoding of the native (non-JPEG-input)
+	// thumbnail path. The zero value, FormatJPEG, preserves the original
+	// behavior. It has no effect on true JPEG inputs, which always go
+	// through the libjpeg-turbo JPEG-to-JPEG fast path.
+	OutputFormat OutputFormat
+}
+
+// Result carries metadata produced alongside a thumbnail by Process/Create
+// and their variants.
+type Result struct {
+	// BlurHash is set when the corresponding Options.EmitBlurHash was true.
+	BlurHash string
+}
+
+// resizePlan describes how to scale a source image and, for modes that must
+// hit an exact output size, where to place the scaled image within the final
+// canvas.
+type resizePlan struct {
+	scaleW, scaleH   int // dimensions to resize the source into
+	finalW, finalH   int // dimensions of the final output canvas
+	offsetX, offsetY int // placement of the scaled image within the final canvas
+}
+
+// planResize computes the intermediate scale size and final canvas size for
+// the given mode. For ModeScale/ModeFit the canvas matches the scaled size
+// exactly, so no cropping or padding is required.
+func planResize(srcW, srcH, maxWidth, maxHeight int, mode ResizeMode) resizePlan {
+	if maxWidth <= 0 || maxHeight <= 0 || srcW <= 0 || srcH <= 0 {
+		return resizePlan{scaleW: srcW, scaleH: srcH, finalW: srcW, finalH: srcH}
+	}
+
+	switch mode {
+	case ModeCrop:
+		ratio := math.Max(float64(maxWidth)/float64(srcW), float64(maxHeight)/float64(srcH))
+		scaleW := int(math.Max(1.0, float64(srcW)*ratio))
+		scaleH := int(math.Max(1.0, float64(srcH)*ratio))
+		return resizePlan{
+			scaleW: scaleW, scaleH: scaleH,
+			finalW: maxWidth, finalH: maxHeight,
+			offsetX: (scaleW - maxWidth) / 2,
+			offsetY: (scaleH - maxHeight) / 2,
+		}
+	case ModePad:
+		ratio := math.Min(float64(maxWidth)/float64(srcW), float64(maxHeight)/float64(srcH))
+		scaleW := int(math.Max(1.0, float64(srcW)*ratio))
+		scaleH := int(math.Max(1.0, float64(srcH)*ratio))
+		return resizePlan{
+			scaleW: scaleW, scaleH: scaleH,
+			finalW: maxWidth, finalH: maxHeight,
+			offsetX: (maxWidth - scaleW) / 2,
+			offsetY: (maxHeight - scaleH) / 2,
+		}
+	default: // ModeScale, ModeFit
+		// Never upscale: only shrink to fit, matching the library's
+		// original behavior.
+		ratio := math.Min(1.0, math.Min(float64(maxWidth)/float64(srcW), float64(maxHeight)/float64(srcH)))
+		scaleW := int(math.Max(1.0, float64(srcW)*ratio))
+		scaleH := int(math.Max(1.0, float64(srcH)*ratio))
+		return resizePlan{scaleW: scaleW, scaleH: scaleH, finalW: scaleW, finalH: scaleH}
+	}
+}
+
+// cropImage returns a new image containing the offsetX,offsetY sub-rectangle
+// of src sized finalW x finalH, center-cropping a scaled intermediate down to
+// the exact requested dimensions.
+func cropImage(src image.Image, offsetX, offsetY, finalW, finalH int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, finalW, finalH))
+	srcMin := src.Bounds().Min.Add(image.Pt(offsetX, offsetY))
+	draw.Draw(dst, dst.Bounds(), src, srcMin, draw.Src)
+	return dst
+}
+
+// padImage returns a new finalW x finalH image with src centered over a
+// padColor background, for modes that must hit an exact size without
+// cropping any content.
+func padImage(src image.Image, offsetX, offsetY, finalW, finalH int, padColor color.RGBA) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, finalW, finalH))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{C: padColor}, image.Point{}, draw.Src)
+	b := src.Bounds()
+	destRect := image.Rect(offsetX, offsetY, offsetX+b.Dx(), offsetY+b.Dy())
+	draw.Draw(dst, destRect, src, b.Min, draw.Src)
+	return dst
 }
 
 // bufferPool holds reusable buffers for image pixel data, reducing GC pressure.
@@ -40,22 +187,242 @@ var bufferPool = sync.Pool{
 // Create generates a single thumbnail from an input path to an output path.
 // It automatically detects the input format and uses the highly optimized
 // JPEG path when possible. The output is always a JPEG.
-func Create(inputPath, outputPath string, opts Options) error {
+func Create(inputPath, outputPath string, opts Options) (Result, error) {
 	in, err := os.Open(inputPath)
 	if err != nil {
-		return err
+		return Result{}, err
 	}
 	defer in.Close()
 
 	out, err := os.Create(outputPath)
 	if err != nil {
-		return err
+		return Result{}, err
 	}
 	defer out.Close()
 
 	return Process(in, out, opts)
 }
 
+// Target bundles a destination writer with the Options to render for it, for
+// use with ProcessMulti and CreateMulti.
+type Target struct {
+	Out  io.Writer
+	Opts Options
+}
+
+// CreateMulti generates several thumbnails from a single input path,
+// decoding the source image only once. outputs maps each output path to the
+// Options to render for it.
+func CreateMulti(inputPath string, outputs map[string]Options) (map[string]Result, error) {
+	in, err := os.Open(inputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	paths := make([]string, 0, len(outputs))
+	targets := make([]Target, 0, len(outputs))
+	opened := make([]*os.File, 0, len(outputs))
+	defer func() {
+		for _, f := range opened {
+			f.Close()
+		}
+	}()
+
+	for path, opts := range outputs {
+		out, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		opened = append(opened, out)
+		paths = append(paths, path)
+		targets = append(targets, Target{Out: out, Opts: opts})
+	}
+
+	results, err := ProcessMulti(in, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	byPath := make(map[string]Result, len(paths))
+	for i, path := range paths {
+		byPath[path] = results[i]
+	}
+	return byPath, nil
+}
+
+// ProcessMulti generates several thumbnails from a single io.ReadSeeker,
+// decoding the source image only once. This avoids the per-size decode cost
+// of calling Process repeatedly when a caller wants several output sizes
+// from the same upload (e.g. 32x32, 96x96, and 320x240 previews). JPEG
+// inputs always produce JPEGs; other inputs are encoded per each target's
+// OutputFormat. An animated GIF input is decoded to its first frame only:
+// Options.Frame is not consulted, and FormatGIF yields a single-frame GIF.
+//
+// The shared decode is protected by the same MaxInputBytes/MaxInputPixels/
+// MaxInputDimension limits as Process: since targets may set these
+// differently, the most restrictive positive limit across all targets is
+// the one enforced.
+func ProcessMulti(in io.ReadSeeker, targets []Target) ([]Result, error) {
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return nil, err
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	isJPEG := header[0] == 0xFF && header[1] == 0xD8
+
+	limits := mergedInputLimits(targets)
+	if limits.MaxInputPixels > 0 || limits.MaxInputDimension > 0 {
+		if err := checkInputDimensions(in, isJPEG, limits); err != nil {
+			return nil, err
+		}
+	}
+
+	var limited io.ReadSeeker = in
+	if limits.MaxInputBytes > 0 {
+		limited = newLimitedReadSeeker(in, limits.MaxInputBytes+1)
+	}
+
+	if isJPEG {
+		return processMultiJPEG(limited, targets)
+	}
+	return processMultiNative(limited, targets)
+}
+
+// mergedInputLimits combines the MaxInputBytes/MaxInputPixels/
+// MaxInputDimension across targets into the single set of limits ProcessMulti
+// enforces on its one shared decode: the smallest positive value configured
+// for each field, so that no target's limit can be bypassed by a laxer
+// sibling target in the same call.
+func mergedInputLimits(targets []Target) Options {
+	var merged Options
+	for _, t := range targets {
+		merged.MaxInputBytes = minPositive64(merged.MaxInputBytes, t.Opts.MaxInputBytes)
+		merged.MaxInputPixels = minPositive64(merged.MaxInputPixels, t.Opts.MaxInputPixels)
+		merged.MaxInputDimension = minPositiveInt(merged.MaxInputDimension, t.Opts.MaxInputDimension)
+	}
+	return merged
+}
+
+// minPositive64 returns the smaller of a and b, treating a non-positive value
+// as "unset" rather than zero.
+func minPositive64(a, b int64) int64 {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || b > a {
+		return a
+	}
+	return b
+}
+
+// minPositiveInt is minPositive64 for int-valued limits.
+func minPositiveInt(a, b int) int {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || b > a {
+		return a
+	}
+	return b
+}
+
+// processMultiJPEG decodes the source once, using the smallest libjpeg-turbo
+// IDCT scaleDenom that still satisfies the largest requested target, then
+// downscales from that single RGBA intermediate for every target.
+func processMultiJPEG(in io.ReadSeeker, targets []Target) ([]Result, error) {
+	cfg, err := libjpeg.DecodeConfig(in)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	maxReqW, maxReqH := 1, 1
+	for _, t := range targets {
+		if t.Opts.MaxWidth > maxReqW {
+			maxReqW = t.Opts.MaxWidth
+		}
+		if t.Opts.MaxHeight > maxReqH {
+			maxReqH = t.Opts.MaxHeight
+		}
+	}
+
+	wRatio := float64(cfg.Width) / float64(maxReqW)
+	hRatio := float64(cfg.Height) / float64(maxReqH)
+	ratio := math.Max(wRatio, hRatio)
+
+	scaleDenom := 1
+	if ratio > 8 {
+		scaleDenom = 8
+	} else if ratio > 4 {
+		scaleDenom = 4
+	} else if ratio > 2 {
+		scaleDenom = 2
+	}
+
+	targetWidth := cfg.Width / scaleDenom
+	targetHeight := cfg.Height / scaleDenom
+	decodeOpts := &libjpeg.DecoderOptions{
+		ScaleTarget: image.Rect(0, 0, targetWidth, targetHeight),
+	}
+
+	scaledImg, err := libjpeg.Decode(in, decodeOpts)
+	if err != nil {
+		if strings.Contains(err.Error(), "suspension") {
+			// Log this as a warning, but continue processing the partial image
+		} else {
+			return nil, err
+		}
+	}
+
+	var srcImg *image.RGBA
+	if rgba, ok := scaledImg.(*image.RGBA); ok {
+		srcImg = rgba
+	} else {
+		b := scaledImg.Bounds()
+		srcImg = image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+		draw.Draw(srcImg, srcImg.Bounds(), scaledImg, b.Min, draw.Src)
+	}
+
+	results := make([]Result, len(targets))
+	for i, t := range targets {
+		result, err := encodeJPEGFromRGBA(srcImg, t.Out, t.Opts)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// processMultiNative decodes a non-JPEG source once and downscales it for
+// every target using the standard Go image libraries.
+func processMultiNative(in io.Reader, targets []Target) ([]Result, error) {
+	img, _, err := image.Decode(in)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]Result, len(targets))
+	for i, t := range targets {
+		result, err := encodeNativeFromImage(img, t.Out, t.Opts)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
 // CreateBatch generates thumbnails for a map of input/output paths concurrently.
 // It uses a pool of workers equal to the number of CPU cores for optimal throughput.
 func CreateBatch(jobs map[string]string, opts Options) {
@@ -69,7 +436,7 @@ func CreateBatch(jobs map[string]string, opts Options) {
 		go func() {
 			defer wg.Done()
 			for job := range jobsCh {
-				if err := Create(job[0], job[1], opts); err != nil {
+				if _, err := Create(job[0], job[1], opts); err != nil {
 					// In a real app, you might want a more robust error handling mechanism
 					fmt.Fprintf(os.Stderr, "ERROR: Failed to process %s: %v\n", job[0], err)
 				}
@@ -90,32 +457,114 @@ func CreateBatch(jobs map[string]string, opts Options) {
 // Process generates a thumbnail from an io.ReadSeeker to an io.Writer.
 // This is the core function that allows for streaming and in-memory processing.
 // The output is always a JPEG.
-func Process(in io.ReadSeeker, out io.Writer, opts Options) error {
+func Process(in io.ReadSeeker, out io.Writer, opts Options) (Result, error) {
 	// Sniff the first few bytes to check if it's a JPEG.
 	header := make([]byte, 2)
 	if _, err := io.ReadFull(in, header); err != nil {
-		return err
+		return Result{}, err
 	}
 	if _, err := in.Seek(0, io.SeekStart); err != nil {
-		return err
+		return Result{}, err
 	}
 
 	isJPEG := header[0] == 0xFF && header[1] == 0xD8
 
+	if opts.MaxInputPixels > 0 || opts.MaxInputDimension > 0 {
+		if err := checkInputDimensions(in, isJPEG, opts); err != nil {
+			return Result{}, err
+		}
+	}
+
+	var limited io.ReadSeeker = in
+	if opts.MaxInputBytes > 0 {
+		limited = newLimitedReadSeeker(in, opts.MaxInputBytes+1)
+	}
+
 	if isJPEG {
-		return createJPEGThumbnail(in, out, opts)
+		return createJPEGThumbnail(limited, out, opts)
+	}
+	return createNativeThumbnail(limited, out, opts)
+}
+
+// checkInputDimensions decodes just the image header to read its dimensions
+// and rejects it with ErrInputTooLarge before any pixel buffers are
+// allocated, protecting HTTP upload pipelines from decode-bomb inputs (a
+// small file that decodes to gigapixels).
+func checkInputDimensions(in io.ReadSeeker, isJPEG bool, opts Options) error {
+	var width, height int
+	if isJPEG {
+		cfg, err := libjpeg.DecodeConfig(in)
+		if err != nil {
+			return err
+		}
+		width, height = cfg.Width, cfg.Height
+	} else {
+		cfg, _, err := image.DecodeConfig(in)
+		if err != nil {
+			return err
+		}
+		width, height = cfg.Width, cfg.Height
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if opts.MaxInputPixels > 0 && int64(width)*int64(height) > opts.MaxInputPixels {
+		return ErrInputTooLarge
+	}
+	if opts.MaxInputDimension > 0 && (width > opts.MaxInputDimension || height > opts.MaxInputDimension) {
+		return ErrInputTooLarge
+	}
+	return nil
+}
+
+// limitedReadSeeker wraps an io.ReadSeeker and returns ErrInputTooLarge once
+// limit bytes from the start have been read, so callers pass one more than
+// the largest accepted size. This
+// is the io.LimitedReader idiom extended to also track Seek, since the
+// decode paths rewind the input between the header sniff and the real decode.
+type limitedReadSeeker struct {
+	r     io.ReadSeeker
+	pos   int64
+	limit int64
+}
+
+func newLimitedReadSeeker(r io.ReadSeeker, limit int64) *limitedReadSeeker {
+	return &limitedReadSeeker{r: r, limit: limit}
+}
+
+func (l *limitedReadSeeker) Read(p []byte) (int, error) {
+	if l.pos >= l.limit {
+		return 0, ErrInputTooLarge
+	}
+	if remaining := l.limit - l.pos; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.pos += int64(n)
+	if l.pos >= l.limit {
+		return n, ErrInputTooLarge
 	}
-	return createNativeThumbnail(in, out, opts)
+	return n, err
+}
+
+func (l *limitedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := l.r.Seek(offset, whence)
+	if err != nil {
+		return pos, err
+	}
+	l.pos = pos
+	return pos, nil
 }
 
 // createJPEGThumbnail is the core of the high-performance JPEG-to-JPEG path.
-func createJPEGThumbnail(in io.ReadSeeker, out io.Writer, opts Options) (err error) {
+func createJPEGThumbnail(in io.ReadSeeker, out io.Writer, opts Options) (Result, error) {
 	cfg, err := libjpeg.DecodeConfig(in)
 	if err != nil {
-		return err
+		return Result{}, err
 	}
 	if _, err := in.Seek(0, io.SeekStart); err != nil {
-		return err
+		return Result{}, err
 	}
 
 	wRatio := float64(cfg.Width) / float64(opts.MaxWidth)
@@ -142,7 +591,7 @@ func createJPEGThumbnail(in io.ReadSeeker, out io.Writer, opts Options) (err err
 		if strings.Contains(err.Error(), "suspension") {
 			// Log this as a warning, but continue processing the partial image
 		} else {
-			return err
+			return Result{}, err
 		}
 	}
 
@@ -155,43 +604,136 @@ func createJPEGThumbnail(in io.ReadSeeker, out io.Writer, opts Options) (err err
 		draw.Draw(srcImg, srcImg.Bounds(), scaledImg, b.Min, draw.Src)
 	}
 
+	return encodeJPEGFromRGBA(srcImg, out, opts)
+}
+
+// encodeJPEGFromRGBA resizes the already-decoded srcImg per opts and encodes
+// the result as a JPEG to out. It is shared by the single-target and
+// multi-target (ProcessMulti) code paths so that a single decoded
+// intermediate can be reused across several output sizes. When
+// opts.EmitBlurHash is set, the BlurHash is computed from srcImg before the
+// final resize, while it is still small and cheap to scan.
+func encodeJPEGFromRGBA(srcImg *image.RGBA, out io.Writer, opts Options) (Result, error) {
+	var result Result
+	if opts.EmitBlurHash {
+		xComp, yComp := blurHashComponents(opts)
+		result.BlurHash = encodeBlurHash(srcImg, xComp, yComp)
+	}
+
 	var finalImg image.Image = srcImg
 	scaledW := srcImg.Bounds().Dx()
 	scaledH := srcImg.Bounds().Dy()
 
-	if scaledW > opts.MaxWidth || scaledH > opts.MaxHeight {
-		finalRatio := math.Min(float64(opts.MaxWidth)/float64(scaledW), float64(opts.MaxHeight)/float64(scaledH))
-		finalW := int(math.Max(1.0, float64(scaledW)*finalRatio))
-		finalH := int(math.Max(1.0, float64(scaledH)*finalRatio))
-
-		resizeBufPtr, resizeDst := getBuffer(finalW, finalH)
+	plan := planResize(scaledW, scaledH, opts.MaxWidth, opts.MaxHeight, opts.ResizeMode)
+	if plan.scaleW != scaledW || plan.scaleH != scaledH {
+		resizeBufPtr, resizeDst := getBuffer(plan.scaleW, plan.scaleH)
 		defer bufferPool.Put(resizeBufPtr)
 
-		resizeRGBA(srcImg, resizeDst)
+		resizeRGBA(srcImg, resizeDst, opts.Interpolation)
 		finalImg = resizeDst
 	}
 
+	if plan.finalW != plan.scaleW || plan.finalH != plan.scaleH {
+		switch opts.ResizeMode {
+		case ModeCrop:
+			finalImg = cropImage(finalImg, plan.offsetX, plan.offsetY, plan.finalW, plan.finalH)
+		case ModePad:
+			finalImg = padImage(finalImg, plan.offsetX, plan.offsetY, plan.finalW, plan.finalH, opts.PadColor)
+		}
+	}
+
 	quality := opts.Quality
 	if quality == 0 {
 		quality = 85
 	}
-	return libjpeg.Encode(out, finalImg, &libjpeg.EncoderOptions{Quality: quality})
+	if err := libjpeg.Encode(out, finalImg, &libjpeg.EncoderOptions{Quality: quality}); err != nil {
+		return Result{}, err
+	}
+	return result, nil
 }
 
-// createNativeThumbnail handles non-JPEG files using the standard Go libraries.
-func createNativeThumbnail(in io.Reader, out io.Writer, opts Options) error {
-	img, _, err := image.Decode(in)
+// createNativeThumbnail handles non-JPEG files using the standard Go
+// libraries. Animated GIFs are routed to createGIFThumbnail, which either
+// picks a single representative frame (per opts.Frame) or re-encodes the
+// whole animation (opts.OutputFormat == FormatGIF).
+func createNativeThumbnail(in io.Reader, out io.Writer, opts Options) (Result, error) {
+	header := make([]byte, 6)
+	n, err := io.ReadFull(in, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return Result{}, err
+	}
+	rest := io.MultiReader(bytes.NewReader(header[:n]), in)
+
+	if isGIFHeader(header[:n]) {
+		return createGIFThumbnail(rest, out, opts)
+	}
+
+	img, _, err := image.Decode(rest)
 	if err != nil {
-		return err
+		return Result{}, err
 	}
+	return encodeNativeFromImage(img, out, opts)
+}
 
-	resizedImg := resize(img, opts.MaxWidth, opts.MaxHeight)
+// encodeNativeFromImage resizes the already-decoded img per opts and encodes
+// it to out in opts.OutputFormat. It is shared by the single-target and
+// multi-target (ProcessMulti) code paths so that a single decoded
+// intermediate can be reused across several output sizes. When
+// opts.EmitBlurHash is set, the BlurHash is computed from the scaled
+// intermediate (before any crop/pad), mirroring the JPEG path's use of the
+// IDCT-downscaled srcImg, so it never runs its O(W*H) DCT over a
+// full-resolution decode.
+func encodeNativeFromImage(img image.Image, out io.Writer, opts Options) (Result, error) {
+	var result Result
 
-	quality := opts.Quality
-	if quality == 0 {
-		quality = 85
+	src := convertToNRGBA(img)
+	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
+	plan := planResize(srcW, srcH, opts.MaxWidth, opts.MaxHeight, opts.ResizeMode)
+
+	var scaled image.Image = src
+	if plan.scaleW != srcW || plan.scaleH != srcH {
+		dst := image.NewNRGBA(image.Rect(0, 0, plan.scaleW, plan.scaleH))
+		resizeNRGBA(src, dst, opts.Interpolation)
+		scaled = dst
+	}
+
+	if opts.EmitBlurHash {
+		xComp, yComp := blurHashComponents(opts)
+		result.BlurHash = encodeBlurHash(scaled, xComp, yComp)
+	}
+
+	resizedImg := scaled
+	if plan.finalW != plan.scaleW || plan.finalH != plan.scaleH {
+		switch opts.ResizeMode {
+		case ModeCrop:
+			resizedImg = cropImage(scaled, plan.offsetX, plan.offsetY, plan.finalW, plan.finalH)
+		case ModePad:
+			resizedImg = padImage(scaled, plan.offsetX, plan.offsetY, plan.finalW, plan.finalH, opts.PadColor)
+		}
+	}
+
+	if err := encodeStatic(resizedImg, out, opts); err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// encodeStatic encodes a single resized image to out per opts.OutputFormat.
+// FormatPNG encodes img with its alpha channel rather than flattening it
+// onto black, so transparency survives.
+func encodeStatic(img image.Image, out io.Writer, opts Options) error {
+	switch opts.OutputFormat {
+	case FormatPNG:
+		return png.Encode(out, img)
+	case FormatGIF:
+		return gifEncode(out, img)
+	default:
+		quality := opts.Quality
+		if quality == 0 {
+			quality = 85
+		}
+		return jpeg.Encode(out, img, &jpeg.Options{Quality: quality})
 	}
-	return jpeg.Encode(out, resizedImg, &jpeg.Options{Quality: quality})
 }
 
 // getBuffer retrieves a sized buffer from the pool.
@@ -210,20 +752,30 @@ func getBuffer(width, height int) (*[]byte, *image.RGBA) {
 	return bufPtr, img
 }
 
-// resize performs a simple, fast downscale of any image.Image.
-func resize(img image.Image, maxWidth, maxHeight int) image.Image {
+// resize scales any image.Image according to opts.ResizeMode, using the
+// opts.Interpolation kernel. ModeCrop and ModePad may enlarge the image.
+func resize(img image.Image, opts Options) image.Image {
 	src := convertToNRGBA(img)
 	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
-	if srcW <= maxWidth && srcH <= maxHeight {
-		return src
-	}
 
-	ratio := math.Min(float64(maxWidth)/float64(srcW), float64(maxHeight)/float64(srcH))
-	dstW, dstH := int(math.Max(1.0, float64(srcW)*ratio)), int(math.Max(1.0, float64(srcH)*ratio))
+	plan := planResize(srcW, srcH, opts.MaxWidth, opts.MaxHeight, opts.ResizeMode)
 
-	dst := image.NewNRGBA(image.Rect(0, 0, dstW, dstH))
-	resizeNRGBA(src, dst)
-	return dst
+	var scaled image.Image = src
+	if plan.scaleW != srcW || plan.scaleH != srcH {
+		dst := image.NewNRGBA(image.Rect(0, 0, plan.scaleW, plan.scaleH))
+		resizeNRGBA(src, dst, opts.Interpolation)
+		scaled = dst
+	}
+
+	if plan.finalW != plan.scaleW || plan.finalH != plan.scaleH {
+		switch opts.ResizeMode {
+		case ModeCrop:
+			return cropImage(scaled, plan.offsetX, plan.offsetY, plan.finalW, plan.finalH)
+		case ModePad:
+			return padImage(scaled, plan.offsetX, plan.offsetY, plan.finalW, plan.finalH, opts.PadColor)
+		}
+	}
+	return scaled
 }
 
 // convertToNRGBA ensures an image is in the NRGBA format.
@@ -237,8 +789,16 @@ func convertToNRGBA(img image.Image) *image.NRGBA {
 	return dst
 }
 
-// resizeRGBA is a high-speed, simple box-resampling for RGBA images.
-func resizeRGBA(src, dst *image.RGBA) {
+// resizeRGBA resamples src into dst using the given interpolation kernel.
+// InterpBox uses the original high-speed box-averaging path when shrinking;
+// enlarging (either axis) and the other kernels go through the separable
+// filtered resampler in resample.go.
+func resizeRGBA(src, dst *image.RGBA, interp Interpolation) {
+	if interp != InterpBox || dst.Bounds().Dx() > src.Bounds().Dx() || dst.Bounds().Dy() > src.Bounds().Dy() {
+		resamplePix(src.Pix, src.Stride, src.Bounds().Dx(), src.Bounds().Dy(), dst.Pix, dst.Stride, dst.Bounds().Dx(), dst.Bounds().Dy(), interp)
+		return
+	}
+
 	dstW, dstH := dst.Bounds().Dx(), dst.Bounds().Dy()
 	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
 	if dstW == 0 || dstH == 0 || srcW == 0 || srcH == 0 {
@@ -282,8 +842,14 @@ func resizeRGBA(src, dst *image.RGBA) {
 	}
 }
 
-// resizeNRGBA is the equivalent for NRGBA images (used in native path).
-func resizeNRGBA(src, dst *image.NRGBA) {
+// resizeNRGBA is the equivalent of resizeRGBA for NRGBA images (used in the
+// native path).
+func resizeNRGBA(src, dst *image.NRGBA, interp Interpolation) {
+	if interp != InterpBox || dst.Bounds().Dx() > src.Bounds().Dx() || dst.Bounds().Dy() > src.Bounds().Dy() {
+		resamplePix(src.Pix, src.Stride, src.Bounds().Dx(), src.Bounds().Dy(), dst.Pix, dst.Stride, dst.Bounds().Dx(), dst.Bounds().Dy(), interp)
+		return
+	}
+
 	dstW, dstH := dst.Bounds().Dx(), dst.Bounds().Dy()
 	srcW, srcH := src.Bounds().Dx(), src.Bounds().Dy()
 	xRatio := float64(srcW) / float64(dstW)
@@ -67,7 +67,7 @@ func BenchmarkThumbnailGeneration(b *testing.B) {
 			if err != nil {
 				b.Fatal(err)
 			}
-			err = Process(in, io.Discard, opts)
+			_, err = Process(in, io.Discard, opts)
 			in.Close() // Close file manually as Process doesn't
 			if err != nil {
 				b.Fatal(err)
@@ -102,7 +102,7 @@ func BenchmarkThumbnailGeneration(b *testing.B) {
 			if err != nil {
 				b.Fatal(err)
 			}
-			err = createNativeThumbnail(in, io.Discard, opts)
+			_, err = createNativeThumbnail(in, io.Discard, opts)
 			in.Close()
 			if err != nil {
 				b.Fatal(err)
@@ -111,6 +111,45 @@ func BenchmarkThumbnailGeneration(b *testing.B) {
 	})
 }
 
+// BenchmarkInterpolation compares the four resize kernels against each other
+// on the same JPEG-to-JPEG path.
+func BenchmarkInterpolation(b *testing.B) {
+	setup(b)
+
+	modes := []struct {
+		name string
+		mode Interpolation
+	}{
+		{"Box", InterpBox},
+		{"Bilinear", InterpBilinear},
+		{"Bicubic", InterpBicubic},
+		{"Lanczos3", InterpLanczos3},
+	}
+
+	for _, m := range modes {
+		opts := Options{
+			MaxWidth:      benchWidth,
+			MaxHeight:     benchHeight,
+			Quality:       85,
+			Interpolation: m.mode,
+		}
+		b.Run(m.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				in, err := os.Open(largeImgPath)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_, err = Process(in, io.Discard, opts)
+				in.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 // To clean up after tests if desired
 func TestMain(m *testing.M) {
 	// Not setting up here to avoid setup cost in non-benchmark tests